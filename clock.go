@@ -0,0 +1,26 @@
+package logrot
+
+import "time"
+
+// Clock supplies the current time used to resolve a Pattern. It exists so
+// tests and callers that need deterministic rotation boundaries can supply
+// their own implementation instead of wall-clock time.
+type Clock interface {
+	Now() time.Time
+}
+
+type utcClock struct{}
+
+func (utcClock) Now() time.Time { return time.Now().UTC() }
+
+type localClock struct{}
+
+func (localClock) Now() time.Time { return time.Now() }
+
+var (
+	// UTC resolves Pattern placeholders against time.Now().UTC().
+	UTC Clock = utcClock{}
+	// Local resolves Pattern placeholders against time.Now() in the
+	// local timezone.
+	Local Clock = localClock{}
+)
@@ -8,6 +8,7 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 )
 
 var (
@@ -19,15 +20,27 @@ type Logger interface {
 	SetOutput(io.Writer)
 }
 
-func mustOpenFileForAppend(name string) *os.File {
+// openFileForAppend opens name for append, remembering it for Open, and
+// returns any error rather than aborting the process.
+func openFileForAppend(name string) (*os.File, error) {
 	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
-		log.Fatalf("error: ", err)
+		return nil, err
 	}
-	// Remember the latest *os.File for the given name
 	filem.Lock()
 	files[name] = f
 	filem.Unlock()
+	return f, nil
+}
+
+// mustOpenFileForAppend is for entry points where there is no reasonable
+// way to continue without the file (initial construction of a LogRot);
+// mid-life rotation uses openFileForAppend and reports the error instead.
+func mustOpenFileForAppend(name string) *os.File {
+	f, err := openFileForAppend(name)
+	if err != nil {
+		log.Fatalf("logrot: open %s: %v", name, err)
+	}
 	return f
 }
 
@@ -48,12 +61,44 @@ func Open(name string) *os.File {
 	return f
 }
 
+// OpenPattern resolves pattern against clock (Local if nil) and opens the
+// resulting path the same way Open does.
+func OpenPattern(pattern string, clock Clock) *os.File {
+	return Open(NewPattern(pattern, clock).Resolve())
+}
+
 // LogRot represents log file that will be reopened on a given signal.
 type LogRot struct {
-	name    string
-	logFile *os.File
-	signal  os.Signal
-	quit    chan struct{}
+	name      string
+	logFile   *os.File
+	signal    os.Signal
+	sigs      chan os.Signal // registered via signal.Notify; stopped on Close
+	quit      chan struct{}
+	done      chan struct{} // closed once the background goroutine has returned
+	closeOnce sync.Once
+
+	// safe is set instead of a bare *os.File identity when the LogRot
+	// was created via WriteTo/WriteAllTo, so log.SetOutput's writer
+	// survives rotation and in-flight writes never race the file swap.
+	safe *safeWriter
+
+	// rotWriter is set instead of logFile when the LogRot was created
+	// via WriteToRotating, in which case rotation is driven by size/time
+	// thresholds rather than by signal.
+	rotWriter *rotatingWriter
+
+	// target is set instead of logFile when the LogRot was created via
+	// WriteToMulti. Unlike logFile, its identity never changes across a
+	// rotation, so loggers that hold onto it keep working after SIGHUP.
+	target *Target
+
+	// pattern is set when the LogRot was created via WriteToPattern, in
+	// which case name tracks the currently resolved path and rotation is
+	// driven by the pattern resolving to a new path rather than by
+	// signal or size.
+	pattern *Pattern
+	symlink string
+	events  chan Event
 
 	loggers []Logger
 
@@ -61,6 +106,21 @@ type LogRot struct {
 	captureStderr bool
 }
 
+// EventType identifies what kind of Event was published on a LogRot's
+// Notify channel.
+type EventType int
+
+// FileRotatedEvent is sent whenever a LogRot created via WriteToPattern
+// rotates to a newly resolved path.
+const FileRotatedEvent EventType = iota
+
+// Event describes a rotation notification delivered via LogRot.Notify.
+type Event struct {
+	Type     EventType
+	Name     string // newly opened path
+	Previous string // path that was in use before rotation
+}
+
 // WriteTo sets the log output to the given file and reopen the file on SIGHUP.
 func WriteTo(name string, loggers ...Logger) *LogRot {
 	return rotateOn(name, syscall.SIGHUP, loggers...)
@@ -74,24 +134,174 @@ func WriteAllTo(name string, loggers ...Logger) *LogRot {
 	return lr
 }
 
+// WriteToMulti sets the log output to name plus the given extra writers via
+// a Target, and reopens name on SIGHUP. Because loggers are handed the
+// Target rather than the raw *os.File, they never need SetOutput called
+// again after the first rotation.
+func WriteToMulti(name string, extra []io.Writer, loggers ...Logger) *LogRot {
+	return rotateOnMulti(name, syscall.SIGHUP, extra, loggers...)
+}
+
+// WriteToRotating sets the log output to name, rotating it on the
+// size/time/retention thresholds described by opts instead of on SIGHUP.
+// Rotated files are kept as name.1, name.2, ... up to opts.MaxFiles, and are
+// gzipped in the background if opts.Compress is set.
+func WriteToRotating(name string, opts RotateOptions, loggers ...Logger) *LogRot {
+	rw, err := newRotatingWriter(name, opts)
+	if err != nil {
+		log.Fatalf("logrot: %v", err)
+	}
+	rl := &LogRot{
+		name:      name,
+		rotWriter: rw,
+		loggers:   loggers,
+	}
+	// Only the dup2 is redone: the rotating writer's identity is unchanged,
+	// and calling SetOutput from inside a logger's own Write would deadlock.
+	rw.onRotate = func() {
+		if rl.captureStdout {
+			rl.dup2(os.Stdout)
+		}
+		if rl.captureStderr {
+			rl.dup2(os.Stderr)
+		}
+	}
+	rl.setOutput()
+	return rl
+}
+
+// WriteToPattern sets the log output to the path produced by resolving
+// pattern (a strftime-style template, e.g. "/var/log/app.%Y%m%d.log")
+// against clock (Local if nil). Whenever the resolved path changes the file
+// is rotated automatically; no SIGHUP is needed. If symlink is non-empty it
+// is kept pointing at the current file. Rotations are published on the
+// channel returned by Notify.
+func WriteToPattern(pattern string, clock Clock, symlink string, loggers ...Logger) *LogRot {
+	p := NewPattern(pattern, clock)
+	path := p.Resolve()
+	rl := &LogRot{
+		name:    path,
+		pattern: p,
+		symlink: symlink,
+		logFile: mustOpenFileForAppend(path),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+		loggers: loggers,
+		events:  make(chan Event, 1),
+	}
+	rl.setOutput()
+	rl.relink()
+	go rl.watchPattern()
+	return rl
+}
+
+// Notify returns the channel on which rotation events are published for a
+// LogRot created via WriteToPattern. It is nil for LogRot values created
+// any other way.
+func (rl *LogRot) Notify() <-chan Event {
+	return rl.events
+}
+
+// watchPattern polls the pattern for a boundary crossing and rotates when
+// the resolved path changes, until Close is called.
+func (rl *LogRot) watchPattern() {
+	defer close(rl.done)
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if next := rl.pattern.Resolve(); next != rl.name {
+				rl.rotateToPath(next)
+			}
+		case <-rl.quit:
+			return
+		}
+	}
+}
+
+// rotateToPath closes the current file, opens path, updates the optional
+// symlink and publishes a FileRotatedEvent.
+func (rl *LogRot) rotateToPath(path string) {
+	oldLog := rl.logFile
+	prev := rl.name
+	rl.logFile = mustOpenFileForAppend(path)
+	rl.name = path
+	rl.setOutput()
+	oldLog.Close()
+	rl.relink()
+	rl.publish(Event{Type: FileRotatedEvent, Name: path, Previous: prev})
+}
+
+// relink repoints rl.symlink at rl.name, if a symlink path was configured.
+func (rl *LogRot) relink() {
+	if rl.symlink == "" {
+		return
+	}
+	tmp := rl.symlink + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(rl.name, tmp); err != nil {
+		log.Printf("logrot: symlink %s -> %s: %v", tmp, rl.name, err)
+		return
+	}
+	if err := os.Rename(tmp, rl.symlink); err != nil {
+		log.Printf("logrot: rename %s -> %s: %v", tmp, rl.symlink, err)
+	}
+}
+
+// publish delivers e on rl.events without blocking if nobody is listening.
+func (rl *LogRot) publish(e Event) {
+	if rl.events == nil {
+		return
+	}
+	select {
+	case rl.events <- e:
+	default:
+	}
+}
+
 // rotateOn rotates the log file on the given signals
 func rotateOn(name string, sig os.Signal, loggers ...Logger) *LogRot {
+	f := mustOpenFileForAppend(name)
+	rl := &LogRot{
+		name:    name,
+		signal:  sig,
+		logFile: f,
+		safe:    newSafeWriter(f),
+		quit:    make(chan struct{}),
+		loggers: loggers,
+	}
+	rl.start()
+	return rl
+}
+
+// rotateOnMulti is like rotateOn but drives a Target instead of a plain
+// *os.File, so extra writers stay wired up across rotations.
+func rotateOnMulti(name string, sig os.Signal, extra []io.Writer, loggers ...Logger) *LogRot {
 	rl := &LogRot{
 		name:    name,
 		signal:  sig,
-		logFile: mustOpenFileForAppend(name),
+		target:  newTarget(name, extra),
 		quit:    make(chan struct{}),
 		loggers: loggers,
 	}
+	rl.start()
+	return rl
+}
 
+// start applies the initial output and launches the goroutine that rotates
+// on rl.signal until Close is called.
+func (rl *LogRot) start() {
 	rl.setOutput()
 
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, sig)
+	rl.sigs = make(chan os.Signal, 1)
+	rl.done = make(chan struct{})
+	signal.Notify(rl.sigs, rl.signal)
 	go func() {
+		defer close(rl.done)
 		for {
 			select {
-			case s := <-sigs:
+			case s := <-rl.sigs:
 				if s == rl.signal {
 					log.Printf("%s received - rotating log file handle on %s\n", s, rl.name)
 					rl.rotate()
@@ -101,42 +311,161 @@ func rotateOn(name string, sig os.Signal, loggers ...Logger) *LogRot {
 			}
 		}
 	}()
-	return rl
+}
+
+// output returns the io.Writer that log output is currently directed to:
+// the safeWriter for WriteTo/WriteAllTo, the rotating file for
+// WriteToRotating, the Target for WriteToMulti, or the plain *os.File for
+// WriteToPattern.
+func (rl *LogRot) output() io.Writer {
+	if rl.safe != nil {
+		return rl.safe
+	}
+	if rl.rotWriter != nil {
+		return rl.rotWriter
+	}
+	if rl.target != nil {
+		return rl.target
+	}
+	return rl.logFile
 }
 
 func (rl *LogRot) setOutput() {
-	log.SetOutput(rl.logFile)
+	out := rl.output()
+	log.SetOutput(out)
 	for _, l := range rl.loggers {
-		l.SetOutput(rl.logFile)
+		l.SetOutput(out)
 	}
 	if rl.captureStdout {
-		os.Stdout = rl.logFile
+		rl.dup2(os.Stdout)
 	}
 	if rl.captureStderr {
-		os.Stderr = rl.logFile
+		rl.dup2(os.Stderr)
 	}
 }
 
-func (rl *LogRot) Close() {
-	if rl != nil && rl.logFile != nil {
-		rl.quit <- struct{}{}
-		rl.logFile.Close()
+// Close stops any background rotation goroutine, waits for it to actually
+// exit, and closes the underlying file(s). It is idempotent and safe to
+// call more than once or concurrently.
+func (rl *LogRot) Close() error {
+	if rl == nil {
+		return nil
+	}
+	var err error
+	rl.closeOnce.Do(func() {
+		if rl.sigs != nil {
+			signal.Stop(rl.sigs)
+		}
+		if rl.quit != nil {
+			close(rl.quit)
+		}
+		if rl.done != nil {
+			<-rl.done
+		}
+		if rl.logFile != nil {
+			err = rl.logFile.Close()
+		}
+		if rl.rotWriter != nil {
+			if e := rl.rotWriter.Close(); err == nil {
+				err = e
+			}
+		}
+		if rl.target != nil {
+			if e := rl.target.Close(); err == nil {
+				err = e
+			}
+		}
+	})
+	return err
+}
+
+// Rotate reopens rl's log destination, mirroring the LogTarget.Rotate()
+// interface pattern. It is what the SIGHUP handler calls internally, but
+// callers can also invoke it directly for non-signal triggers such as an
+// HTTP admin endpoint or a test.
+func (rl *LogRot) Rotate() error {
+	switch {
+	case rl.target != nil:
+		if err := rl.target.Rotate(); err != nil {
+			return err
+		}
+		rl.setOutput()
+		return nil
+	case rl.rotWriter != nil:
+		// rotWriter.onRotate already re-dup2s captured stdout/stderr on
+		// success; the writer identity the loggers hold does not change.
+		return rl.rotWriter.Rotate()
+	case rl.pattern != nil:
+		rl.rotateToPath(rl.pattern.Resolve())
+		return nil
+	default:
+		next, err := openFileForAppend(rl.name)
+		if err != nil {
+			return err
+		}
+		old := rl.safe.swap(next)
+		rl.logFile = next
+		rl.setOutput()
+		return old.Close()
 	}
 }
 
 func (rl *LogRot) rotate() {
-	oldLog := rl.logFile
-	rl.logFile = mustOpenFileForAppend(rl.name)
-	rl.setOutput()
-	oldLog.Close()
+	if err := rl.Rotate(); err != nil {
+		log.Printf("logrot: rotating %s: %v", rl.name, err)
+	}
 }
 
+// CaptureStdout dup2's rl's current log file descriptor onto fd 1, so that
+// os.Stdout and any child process or C library that inherited fd 1 write to
+// the rotated destination too. It works across every construction path
+// (WriteTo, WriteToMulti, WriteToRotating, WriteToPattern) and is re-applied
+// after each rotation, including a size/time-triggered rotation that
+// WriteToRotating drives internally from a Write call. With
+// RotateOptions.CopyTruncate the dup keeps the same fd across a rotation, so
+// there is nothing to redo, and rotateLocked already reset the write offset.
 func (rl *LogRot) CaptureStdout() {
 	rl.captureStdout = true
-	os.Stdout = rl.logFile
+	rl.dup2(os.Stdout)
 }
 
+// CaptureStderr is CaptureStdout for fd 2 / os.Stderr.
 func (rl *LogRot) CaptureStderr() {
 	rl.captureStderr = true
-	os.Stderr = rl.logFile
+	rl.dup2(os.Stderr)
+}
+
+// fdFile is implemented by writer identities whose current underlying file
+// descriptor can change across a rotation (safeWriter, rotatingWriter,
+// Target), each guarding the read with whatever lock also guards the swap,
+// so dup2 never races a rotation the way reading rl.logFile directly would.
+type fdFile interface {
+	Fd() (uintptr, bool)
+}
+
+// currentFd returns the fd that CaptureStdout/CaptureStderr should dup2
+// onto fd 1/2: rl.output()'s own fd when it exposes one (WriteTo/WriteAllTo
+// via safeWriter, WriteToRotating, WriteToMulti), falling back to the bare
+// rl.logFile only for the pattern-driven path, which has no wrapper.
+func (rl *LogRot) currentFd() (uintptr, bool) {
+	if f, ok := rl.output().(fdFile); ok {
+		return f.Fd()
+	}
+	if rl.logFile != nil {
+		return rl.logFile.Fd(), true
+	}
+	return 0, false
+}
+
+// dup2 duplicates rl's current log file descriptor onto dst's fd (1 or 2),
+// so writers holding dst - including ones outside this process - see the
+// rotated destination without ever being handed a new *os.File.
+func (rl *LogRot) dup2(dst *os.File) {
+	fd, ok := rl.currentFd()
+	if !ok {
+		return
+	}
+	if err := syscall.Dup2(int(fd), int(dst.Fd())); err != nil {
+		log.Printf("logrot: dup2 onto fd %d: %v", dst.Fd(), err)
+	}
 }
@@ -0,0 +1,64 @@
+package logrot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Pattern resolves a strftime-style filename pattern (e.g.
+// "/var/log/app.%Y%m%d.log" or "access_log.%Y-%m-%d_%H") to a concrete path
+// using clock. Resolve is cheap enough to call on every tick; callers
+// rotate whenever the resolved path changes.
+type Pattern struct {
+	raw   string
+	clock Clock
+}
+
+// NewPattern returns a Pattern that formats raw against clock. A nil clock
+// defaults to Local.
+func NewPattern(raw string, clock Clock) *Pattern {
+	if clock == nil {
+		clock = Local
+	}
+	return &Pattern{raw: raw, clock: clock}
+}
+
+// Resolve formats the pattern against the clock's current time.
+func (p *Pattern) Resolve() string {
+	return strftime(p.raw, p.clock.Now())
+}
+
+// strftime supports the subset of strftime placeholders needed for log
+// filenames: %Y %m %d %H %M %S and a literal %%.
+func strftime(pattern string, t time.Time) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c != '%' || i+1 >= len(pattern) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(pattern[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,449 @@
+package logrot
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateOptions controls size- and time-based rotation performed by
+// WriteToRotating, independent of the SIGHUP-triggered rotation used by
+// WriteTo.
+type RotateOptions struct {
+	// MaxBytes is the size in bytes at which the active log file is
+	// rotated. Zero disables size-based rotation.
+	MaxBytes int64
+
+	// MaxAge is how long a rotated file is kept on disk before it is
+	// deleted. Zero disables age-based deletion.
+	MaxAge time.Duration
+
+	// RotationInterval, if non-zero, rotates the active log file once
+	// this much time has passed since the last rotation (e.g. 24h for
+	// daily rotation).
+	RotationInterval time.Duration
+
+	// MaxFiles caps how many rotated files (name.1 .. name.MaxFiles) are
+	// kept. The oldest is deleted once the cap is exceeded. Zero means
+	// unbounded.
+	MaxFiles int
+
+	// Compress gzips a rotated file in the background after it is
+	// closed, replacing name.N with name.N.gz.
+	Compress bool
+
+	// CopyTruncate copies the active file's contents to
+	// name.<timestamp>.<seq> and truncates it in place instead of renaming it away and reopening
+	// a new one. Use this to cooperate with external logrotate(8)
+	// copytruncate configurations, or when some other process holds name
+	// open (including via dup2, see CaptureStdout/CaptureStderr) and
+	// can't be handed a new fd. The file's offset is reset with
+	// Seek(0, io.SeekStart) right after the truncate, so a CaptureStdout-
+	// or CaptureStderr-captured fd keeps writing at the start of the
+	// now-empty file rather than at its old, now out-of-bounds offset.
+	CopyTruncate bool
+}
+
+// rotatingWriter is an io.WriteCloser over a named file that rotates the
+// file once it grows past MaxBytes or once RotationInterval has elapsed,
+// keeping up to MaxFiles rotated copies.
+type rotatingWriter struct {
+	mu   sync.Mutex
+	name string
+	opts RotateOptions
+
+	file      *os.File
+	size      int64
+	rotatedAt time.Time
+
+	// compressSeq numbers the staging names startCompress hands to
+	// background compressions, so two in-flight compressions never target
+	// the same path. Only touched with rw.mu held.
+	compressSeq int
+
+	// copyTruncateSeq disambiguates copyTruncateLocked's backup filenames,
+	// which are only timestamped to a 1-second resolution, from two
+	// rotations landing in the same second. Only touched with rw.mu held.
+	copyTruncateSeq int
+
+	// pending tracks background compressions that haven't placed their
+	// .gz output yet. shiftRotated bumps a job's final alongside the
+	// name.N it's shifting, so a compression that outlives more than one
+	// rotation still lands in the slot it logically owns instead of
+	// colliding with whatever rotates into its original name.N next. Only
+	// touched with rw.mu held.
+	pending []*compressJob
+
+	// onRotate, if set, is called after a successful rotation, with rw.mu
+	// not held, so LogRot can re-dup2 a captured stdout/stderr onto the
+	// new file's fd.
+	onRotate func()
+
+	quit chan struct{}
+	done chan struct{} // closed once tick() returns; nil if tick was never started
+}
+
+// compressJob is a background compression in flight. final is the name.N
+// path (no .gz suffix) its output should eventually land at; it's mutated
+// by shiftRotated while rw.mu is held, so it always reflects the job's
+// current logical slot even if it's been bumped since the job started.
+type compressJob struct {
+	final string
+}
+
+func newRotatingWriter(name string, opts RotateOptions) (*rotatingWriter, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	if fi, err := f.Stat(); err == nil {
+		size = fi.Size()
+	}
+	rw := &rotatingWriter{
+		name:      name,
+		opts:      opts,
+		file:      f,
+		size:      size,
+		rotatedAt: time.Now(),
+		quit:      make(chan struct{}),
+	}
+	if opts.RotationInterval > 0 || opts.MaxAge > 0 {
+		rw.done = make(chan struct{})
+		go rw.tick()
+	}
+	return rw, nil
+}
+
+// tick periodically checks for time-based rotation and prunes aged rotated
+// files. It runs until Close is called.
+func (rw *rotatingWriter) tick() {
+	defer close(rw.done)
+	interval := rw.opts.RotationInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			rw.mu.Lock()
+			rotated := false
+			if rw.opts.RotationInterval > 0 && time.Since(rw.rotatedAt) >= rw.opts.RotationInterval {
+				rotated = rw.rotateLocked() == nil
+			}
+			if rw.opts.MaxAge > 0 {
+				rw.pruneAgedLocked()
+			}
+			rw.mu.Unlock()
+			if rotated && rw.onRotate != nil {
+				rw.onRotate()
+			}
+		case <-rw.quit:
+			return
+		}
+	}
+}
+
+// Write implements io.Writer, rotating the underlying file first if p would
+// push it past MaxBytes.
+func (rw *rotatingWriter) Write(p []byte) (int, error) {
+	rw.mu.Lock()
+	rotated := false
+	if rw.opts.MaxBytes > 0 && rw.size+int64(len(p)) > rw.opts.MaxBytes {
+		if err := rw.rotateLocked(); err != nil {
+			rw.mu.Unlock()
+			return 0, err
+		}
+		rotated = true
+	}
+	n, err := rw.file.Write(p)
+	rw.size += int64(n)
+	rw.mu.Unlock()
+	if rotated && rw.onRotate != nil {
+		rw.onRotate()
+	}
+	return n, err
+}
+
+// rotateLocked rotates the active file, either via copyTruncateLocked or,
+// by default, by closing it, shifting name.N -> name.N+1 (dropping
+// anything beyond MaxFiles), renaming the current file to name.1,
+// optionally compressing it in the background via startCompress, and
+// reopening name fresh. rw.mu must be held.
+func (rw *rotatingWriter) rotateLocked() error {
+	if rw.opts.CopyTruncate {
+		return rw.copyTruncateLocked()
+	}
+	if err := rw.file.Close(); err != nil {
+		return err
+	}
+	if err := rw.shiftRotated(rw.opts.MaxFiles); err != nil {
+		return err
+	}
+	if err := os.Rename(rw.name, rw.name+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if rw.opts.Compress {
+		rw.startCompress(rw.name + ".1")
+	}
+	f, err := os.OpenFile(rw.name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	rw.file = f
+	rw.size = 0
+	rw.rotatedAt = time.Now()
+	return nil
+}
+
+// startCompress moves final aside to a uniquely-numbered staging path -
+// immune to a later shiftRotated, which only ever touches the exact
+// name.N / name.N.gz paths - then hands it to a background compressFile.
+// The job is tracked in rw.pending so a subsequent shiftRotated can bump
+// where its output belongs; once compressFile finishes, the result is
+// moved into the job's current final+".gz" under rw.mu, the same lock
+// shiftRotated runs under, so the placement can't race a concurrent shift.
+// The gzip itself runs with no lock held, so it never blocks an unrelated
+// Write. rw.mu must be held.
+func (rw *rotatingWriter) startCompress(final string) {
+	rw.compressSeq++
+	staged := fmt.Sprintf("%s.compressing.%d", final, rw.compressSeq)
+	if err := os.Rename(final, staged); err != nil {
+		return
+	}
+	job := &compressJob{final: final}
+	rw.pending = append(rw.pending, job)
+	go func() {
+		compressFile(staged)
+		rw.mu.Lock()
+		for i, j := range rw.pending {
+			if j == job {
+				rw.pending = append(rw.pending[:i], rw.pending[i+1:]...)
+				break
+			}
+		}
+		dst := job.final
+		rw.mu.Unlock()
+		os.Rename(staged+".gz", dst+".gz")
+	}()
+}
+
+// copyTruncateLocked copies the active file's current contents out to
+// name.<timestamp>.<seq> and truncates the active file in place, keeping
+// the same fd open throughout so that anything holding it (a dup2'd
+// stdout/stderr, an external process) keeps writing to the same
+// destination. seq disambiguates two rotations landing in the same
+// wall-clock second, which the timestamp alone can't tell apart. rw.mu
+// must be held.
+func (rw *rotatingWriter) copyTruncateLocked() error {
+	rw.copyTruncateSeq++
+	dst := fmt.Sprintf("%s.%s.%d", rw.name, time.Now().Format("20060102150405"), rw.copyTruncateSeq)
+	src, err := os.Open(rw.name)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		src.Close()
+		return err
+	}
+	_, err = io.Copy(out, src)
+	src.Close()
+	out.Close()
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	if rw.opts.Compress {
+		go compressFile(dst)
+	}
+	if err := rw.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := rw.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	rw.size = 0
+	rw.rotatedAt = time.Now()
+	return nil
+}
+
+// shiftRotated renames name.N to name.N+1 for N going from top-1 down to 1,
+// where top is maxFiles if maxFiles > 0 (after deleting name.maxFiles and
+// its .gz form first so the cap is enforced), or the highest index
+// currently occupied - on disk or by a still-running background
+// compression - if maxFiles <= 0, so the unbounded case keeps growing
+// name.1, name.2, ... instead of clobbering name.1 on every rotation. Any
+// rw.pending job targeting name.i is bumped to name.i+1 alongside the
+// physical rename, so a compression that outlives this rotation still ends
+// up in the slot it logically owns. rw.mu must be held.
+func (rw *rotatingWriter) shiftRotated(maxFiles int) error {
+	top := maxFiles
+	if top > 0 {
+		oldest := fmt.Sprintf("%s.%d", rw.name, top)
+		os.Remove(oldest)
+		os.Remove(oldest + ".gz")
+	} else {
+		top = rw.highestOccupiedIndex() + 1
+	}
+	for i := top - 1; i >= 1; i-- {
+		for _, ext := range []string{"", ".gz"} {
+			src := fmt.Sprintf("%s.%d%s", rw.name, i, ext)
+			dst := fmt.Sprintf("%s.%d%s", rw.name, i+1, ext)
+			if _, err := os.Stat(src); err == nil {
+				if err := os.Rename(src, dst); err != nil {
+					return err
+				}
+			}
+		}
+		srcFinal := fmt.Sprintf("%s.%d", rw.name, i)
+		dstFinal := fmt.Sprintf("%s.%d", rw.name, i+1)
+		for _, job := range rw.pending {
+			if job.final == srcFinal {
+				job.final = dstFinal
+			}
+		}
+	}
+	return nil
+}
+
+// highestOccupiedIndex is highestRotatedIndex widened to also cover slots a
+// still-running background compression logically owns: its file has
+// already been moved aside to a staging path by startCompress, so it
+// wouldn't otherwise show up in the name.N glob. rw.mu must be held.
+func (rw *rotatingWriter) highestOccupiedIndex() int {
+	highest := highestRotatedIndex(rw.name)
+	for _, job := range rw.pending {
+		if n, ok := rotatedIndex(rw.name, job.final); ok && n > highest {
+			highest = n
+		}
+	}
+	return highest
+}
+
+// highestRotatedIndex scans for name.N and name.N.gz files and returns the
+// largest N found, or 0 if there are none.
+func highestRotatedIndex(name string) int {
+	matches, err := filepath.Glob(name + ".[0-9]*")
+	if err != nil {
+		return 0
+	}
+	highest := 0
+	for _, m := range matches {
+		if n, ok := rotatedIndex(name, m); ok && n > highest {
+			highest = n
+		}
+	}
+	return highest
+}
+
+// rotatedIndex parses the trailing N out of a name.N or name.N.gz path. It
+// returns false for anything else, including the name.N.compressing.M
+// staging paths startCompress uses, which deliberately don't parse as a
+// plain index.
+func rotatedIndex(name, path string) (int, bool) {
+	rest := strings.TrimSuffix(strings.TrimPrefix(path, name+"."), ".gz")
+	n, err := strconv.Atoi(rest)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// compressFile gzips path into path+".gz" and removes path. Errors are not
+// fatal to the caller; a failed compression just leaves the plain rotated
+// file in place.
+func compressFile(path string) {
+	in, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return
+	}
+	defer out.Close()
+	gw := gzip.NewWriter(out)
+	if _, err := io.Copy(gw, in); err != nil {
+		gw.Close()
+		os.Remove(path + ".gz")
+		return
+	}
+	if err := gw.Close(); err != nil {
+		return
+	}
+	os.Remove(path)
+}
+
+// pruneAgedLocked deletes every file matching name.* (rotated name.N and
+// name.N.gz files, copy-truncate backups, compression staging files) whose
+// mtime is older than MaxAge. rw.mu must be held.
+func (rw *rotatingWriter) pruneAgedLocked() {
+	matches, err := filepath.Glob(rw.name + ".*")
+	if err != nil {
+		return
+	}
+	for _, m := range matches {
+		fi, err := os.Stat(m)
+		if err != nil {
+			continue
+		}
+		if time.Since(fi.ModTime()) > rw.opts.MaxAge {
+			os.Remove(m)
+		}
+	}
+}
+
+// Rotate forces an immediate rotation, regardless of the size/time
+// thresholds in RotateOptions. It exists so callers can trigger rotation
+// programmatically (an HTTP admin endpoint, a test) alongside the automatic
+// triggers.
+func (rw *rotatingWriter) Rotate() error {
+	rw.mu.Lock()
+	err := rw.rotateLocked()
+	rw.mu.Unlock()
+	if err == nil && rw.onRotate != nil {
+		rw.onRotate()
+	}
+	return err
+}
+
+// Fd returns the fd of the file currently being written to, so callers like
+// LogRot.dup2 can re-point a captured stdout/stderr at it after a rotation.
+func (rw *rotatingWriter) Fd() (uintptr, bool) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.file == nil {
+		return 0, false
+	}
+	return rw.file.Fd(), true
+}
+
+// Close stops the rotation ticker, waits for it to actually exit, and
+// closes the underlying file. Calls after the first are no-ops returning nil.
+func (rw *rotatingWriter) Close() error {
+	rw.mu.Lock()
+	select {
+	case <-rw.quit:
+		rw.mu.Unlock()
+		return nil
+	default:
+	}
+	close(rw.quit)
+	rw.mu.Unlock()
+	if rw.done != nil {
+		<-rw.done
+	}
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	return rw.file.Close()
+}
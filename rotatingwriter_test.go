@@ -0,0 +1,147 @@
+package logrot
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShiftRotatedUnboundedGrowsWithoutCap(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	rw, err := newRotatingWriter(name, RotateOptions{MaxBytes: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+
+	for i := 0; i < 5; i++ {
+		if _, err := rw.Write([]byte("x")); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+	if err := rw.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 1; n <= 5; n++ {
+		if _, err := os.Stat(name + "." + strconv.Itoa(n)); err != nil {
+			t.Errorf("expected %s.%d to survive, got: %v", name, n, err)
+		}
+	}
+}
+
+func TestShiftRotatedMaxFilesCap(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	rw, err := newRotatingWriter(name, RotateOptions{MaxBytes: 1, MaxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+
+	for i := 0; i < 5; i++ {
+		if _, err := rw.Write([]byte("x")); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+	if err := rw.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(name + ".1"); err != nil {
+		t.Errorf("expected %s.1 to exist: %v", name, err)
+	}
+	if _, err := os.Stat(name + ".2"); err != nil {
+		t.Errorf("expected %s.2 to exist: %v", name, err)
+	}
+	if _, err := os.Stat(name + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected %s.3 to be pruned, stat err: %v", name, err)
+	}
+}
+
+func TestCopyTruncateBackupsDontCollideWithinSameSecond(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	rw, err := newRotatingWriter(name, RotateOptions{CopyTruncate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+
+	if _, err := rw.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rw.Write([]byte("second\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := filepath.Glob(name + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 distinct backups from 2 rotations, got %d: %v", len(matches), matches)
+	}
+}
+
+func TestRotatingWriterCloseWaitsForTick(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	rw, err := newRotatingWriter(name, RotateOptions{RotationInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatalf("second Close should be safe, got: %v", err)
+	}
+}
+
+// TestRotatingWriterConcurrentWriteAndRotate exercises Write and Rotate
+// concurrently, then Close; run with -race to catch data races on the shared
+// state.
+func TestRotatingWriterConcurrentWriteAndRotate(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	rw, err := newRotatingWriter(name, RotateOptions{MaxBytes: 64, MaxFiles: 3, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				rw.Write([]byte("some log line\n"))
+			}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				rw.Rotate()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
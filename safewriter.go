@@ -0,0 +1,56 @@
+package logrot
+
+import (
+	"os"
+	"sync"
+)
+
+// safeWriter is the stable io.Writer identity handed to log.SetOutput (and
+// to any Logger) for SIGHUP-driven rotation. It lets Rotate swap the active
+// *os.File without racing a write already in progress on another
+// goroutine: swap only returns the old file once every write that grabbed
+// it has finished, via a WaitGroup scoped to that file's generation.
+type safeWriter struct {
+	mu   sync.RWMutex
+	file *os.File
+	wg   *sync.WaitGroup
+}
+
+func newSafeWriter(f *os.File) *safeWriter {
+	return &safeWriter{file: f, wg: &sync.WaitGroup{}}
+}
+
+// Write implements io.Writer.
+func (sw *safeWriter) Write(p []byte) (int, error) {
+	sw.mu.RLock()
+	f, wg := sw.file, sw.wg
+	wg.Add(1)
+	sw.mu.RUnlock()
+	defer wg.Done()
+	return f.Write(p)
+}
+
+// swap installs next as the active file and returns the file that was
+// active before, after waiting for any write already in flight against it
+// to return. The caller owns the returned file and must close it.
+func (sw *safeWriter) swap(next *os.File) *os.File {
+	sw.mu.Lock()
+	old, oldWG := sw.file, sw.wg
+	sw.file = next
+	sw.wg = &sync.WaitGroup{}
+	sw.mu.Unlock()
+	oldWG.Wait()
+	return old
+}
+
+// Fd returns the fd of the file currently being written to, so callers like
+// LogRot.dup2 can re-point a captured stdout/stderr at it after a rotation
+// without racing swap.
+func (sw *safeWriter) Fd() (uintptr, bool) {
+	sw.mu.RLock()
+	defer sw.mu.RUnlock()
+	if sw.file == nil {
+		return 0, false
+	}
+	return sw.file.Fd(), true
+}
@@ -0,0 +1,45 @@
+package logrot
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestSafeWriterFdRaceWithSwap exercises Fd concurrently with swap; run with
+// -race to catch a data race on the underlying *os.File.
+func TestSafeWriterFdRaceWithSwap(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.OpenFile(filepath.Join(dir, "a.log"), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sw := newSafeWriter(f)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			if _, ok := sw.Fd(); !ok {
+				t.Error("Fd reported no active file")
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			next, err := os.OpenFile(filepath.Join(dir, "b.log"), os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			old := sw.swap(next)
+			old.Close()
+		}
+	}()
+	wg.Wait()
+	sw.file.Close()
+}
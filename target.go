@@ -0,0 +1,74 @@
+package logrot
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// Target is a stable io.Writer identity that fans writes out to a rotating
+// file plus any number of extra writers (stderr, syslog, a remote shipper).
+// Callers pass a *Target to log.SetOutput (or any Logger.SetOutput) once;
+// Rotate then swaps the underlying file in place, so the writer identity
+// held by the stdlib logger or a third-party logger never goes stale and
+// never points at a closed fd.
+type Target struct {
+	mu    sync.RWMutex
+	name  string
+	extra []io.Writer
+	file  *os.File
+	mw    io.Writer
+}
+
+// newTarget opens name for append and builds a Target that multiplexes
+// writes to it and to extra.
+func newTarget(name string, extra []io.Writer) *Target {
+	f := mustOpenFileForAppend(name)
+	t := &Target{name: name, extra: extra, file: f}
+	t.mw = io.MultiWriter(append([]io.Writer{f}, extra...)...)
+	return t
+}
+
+// Write implements io.Writer.
+func (t *Target) Write(p []byte) (int, error) {
+	t.mu.RLock()
+	mw := t.mw
+	t.mu.RUnlock()
+	return mw.Write(p)
+}
+
+// Rotate closes the current file, reopens name fresh, and rebuilds the
+// multi-writer around it, all without changing the Target's own identity.
+func (t *Target) Rotate() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	old := t.file
+	f, err := os.OpenFile(t.name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	t.file = f
+	t.mw = io.MultiWriter(append([]io.Writer{f}, t.extra...)...)
+	filem.Lock()
+	files[t.name] = f
+	filem.Unlock()
+	return old.Close()
+}
+
+// Close closes the underlying file.
+func (t *Target) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.file.Close()
+}
+
+// Fd returns the fd of the file currently being written to, so callers like
+// LogRot.dup2 can re-point a captured stdout/stderr at it after a rotation.
+func (t *Target) Fd() (uintptr, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.file == nil {
+		return 0, false
+	}
+	return t.file.Fd(), true
+}